@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/mitchellh/packer/common"
+	"io"
+	"os"
+	"strings"
+)
+
+// VerifyChecksum hashes the file at path with checksumType and compares
+// it against checksum. checksumType of "" or "none" skips verification.
+func VerifyChecksum(path string, checksumType string, checksum string) error {
+	if checksumType == "" || checksumType == "none" {
+		return nil
+	}
+
+	h := common.HashForType(checksumType)
+	if h == nil {
+		return fmt.Errorf("Unsupported checksum type: %s", checksumType)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(actual, checksum) {
+		return fmt.Errorf("Checksum mismatch for %s: expected %s, got %s", path, checksum, actual)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"fmt"
+	"github.com/mitchellh/packer/powershell"
+	"github.com/mitchellh/packer/template/interpolate"
+)
+
+// ConnectConfig holds the settings needed to drive PowerShell against a
+// remote Hyper-V host over WinRM/PSRP. When HypervHost is empty, Packer
+// runs PowerShell locally instead, which means it must run on the
+// Hyper-V host itself.
+type ConnectConfig struct {
+	// The hostname or IP of the Hyper-V host to connect to. When not
+	// set, Packer runs PowerShell on the local machine.
+	HypervHost string `mapstructure:"hyperv_host"`
+	// The username used to connect to hyperv_host.
+	HypervUsername string `mapstructure:"hyperv_username"`
+	// The password used to connect to hyperv_host.
+	HypervPassword string `mapstructure:"hyperv_password"`
+	// Whether to connect to hyperv_host over HTTPS instead of HTTP.
+	HypervUseSSL bool `mapstructure:"hyperv_use_ssl"`
+}
+
+func (c *ConnectConfig) Prepare(ctx *interpolate.Context) []error {
+	var errs []error
+
+	if c.HypervHost == "" {
+		if c.HypervUsername != "" || c.HypervPassword != "" {
+			errs = append(errs, fmt.Errorf("hyperv_host must be specified when hyperv_username or hyperv_password is set"))
+		}
+		return errs
+	}
+
+	if c.HypervUsername == "" {
+		errs = append(errs, fmt.Errorf("hyperv_username must be specified when hyperv_host is set"))
+	}
+
+	if c.HypervPassword == "" {
+		errs = append(errs, fmt.Errorf("hyperv_password must be specified when hyperv_host is set"))
+	}
+
+	return errs
+}
+
+// PowerShellCmd builds the powershell.PowerShellCmd to use for a build,
+// based on this ConnectConfig.
+func (c *ConnectConfig) PowerShellCmd() powershell.PowerShellCmd {
+	return powershell.PowerShellCmd{
+		Host:     c.HypervHost,
+		Username: c.HypervUsername,
+		Password: c.HypervPassword,
+		UseSSL:   c.HypervUseSSL,
+	}
+}
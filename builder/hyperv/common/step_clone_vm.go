@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/powershell"
+	"github.com/mitchellh/packer/powershell/hyperv"
+)
+
+// StepCloneVM creates the virtual machine for the vhd builder by
+// cloning an already registered VM (CloneFromVMName), instead of
+// booting an installer off an ISO.
+type StepCloneVM struct {
+	CloneFromVMName string
+
+	VMName     string
+	SwitchName string
+	RamSizeMB  uint
+	Cpu        uint
+}
+
+func (s *StepCloneVM) Run(state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
+
+	errorMsg := "Error cloning vm: %s"
+
+	ui.Say(fmt.Sprintf("Cloning virtual machine %s...", s.CloneFromVMName))
+
+	err := hyperv.CloneVirtualMachine(ps, s.CloneFromVMName, s.VMName, s.SwitchName, s.RamSizeMB, s.Cpu)
+	if err != nil {
+		err := fmt.Errorf(errorMsg, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("vmName", s.VMName)
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCloneVM) Cleanup(state multistep.StateBag) {
+	// do nothing
+}
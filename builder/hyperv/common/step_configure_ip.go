@@ -8,53 +8,62 @@ import (
 	"fmt"
 	"github.com/mitchellh/multistep"
 	"github.com/mitchellh/packer/packer"
-	"strings"
-	"time"
-	"log"
 	powershell "github.com/mitchellh/packer/powershell"
 	"github.com/mitchellh/packer/powershell/hyperv"
+	"strings"
+	"time"
 )
 
+// DefaultIPAddressTimeout is used when IPAddressTimeout is zero.
+const DefaultIPAddressTimeout = 2 * time.Minute
 
 type StepConfigureIp struct {
+	IPAddressTimeout time.Duration
 }
 
 func (s *StepConfigureIp) Run(state multistep.StateBag) multistep.StepAction {
-//	driver := state.Get("driver").(Driver)
 	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
 
 	errorMsg := "Error configuring ip address: %s"
 	vmName := state.Get("vmName").(string)
 
 	ui.Say("Configuring ip address...")
 
-	count := 60
-	var duration time.Duration = 1
-	sleepTime := time.Minute * duration
-	var ip string
+	timeout := s.IPAddressTimeout
+	if timeout == 0 {
+		timeout = DefaultIPAddressTimeout
+	}
+
+	ctx, cancel := stepContext(state, timeout)
+	defer cancel()
 
-	for count != 0 {
-		cmdOut, err := hyperv.GetVirtualMachineNetworkAdapterAddress(vmName)
+	var ip string
+	err := powershell.Retry(ctx, powershell.DefaultRetryPolicy(timeout), func() error {
+		status, err := hyperv.GetIntegrationServiceState(ps, vmName, "Heartbeat")
 		if err != nil {
-			err := fmt.Errorf(errorMsg, err)
-			state.Put("error", err)
-			ui.Error(err.Error())
-			return multistep.ActionHalt
+			return err
+		}
+		if strings.TrimSpace(status) != "OK" {
+			return &powershell.ErrIntegrationServiceUnavailable{VMName: vmName, Service: "Heartbeat"}
 		}
 
-		ip = strings.TrimSpace(string(cmdOut))
+		cmdOut, err := hyperv.GetVirtualMachineNetworkAdapterAddress(ps, vmName)
+		if err != nil {
+			return err
+		}
 
-		if ip != "False" {
-			break;
+		cmdOut = strings.TrimSpace(cmdOut)
+		if cmdOut == "" || cmdOut == "False" {
+			return &powershell.ErrNoGuestIP{VMName: vmName}
 		}
 
-		log.Println(fmt.Sprintf("Waiting for another %v minutes...", uint(duration)))
-		time.Sleep(sleepTime)
-		count--
-	}
+		ip = cmdOut
+		return nil
+	})
 
-	if(count == 0){
-		err := fmt.Errorf(errorMsg, "IP address assigned to the adapter is empty")
+	if err != nil {
+		err := fmt.Errorf(errorMsg, err)
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
@@ -62,7 +71,7 @@ func (s *StepConfigureIp) Run(state multistep.StateBag) multistep.StepAction {
 
 	ui.Say("ip address is " + ip)
 
-	hostName, err := powershell.GetHostName(ip);
+	hostName, err := powershell.GetHostName(ps, ip)
 	if err != nil {
 		state.Put("error", err)
 		ui.Error(err.Error())
@@ -80,4 +89,3 @@ func (s *StepConfigureIp) Run(state multistep.StateBag) multistep.StepAction {
 func (s *StepConfigureIp) Cleanup(state multistep.StateBag) {
 	// do nothing
 }
-
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"github.com/mitchellh/multistep"
 	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/powershell"
 	"github.com/mitchellh/packer/powershell/hyperv"
 )
 
@@ -23,6 +24,7 @@ func (s *StepConfigureVlan) Run(state multistep.StateBag) multistep.StepAction {
 	//config := state.Get("config").(*config)
 	//driver := state.Get("driver").(Driver)
 	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
 
 	errorMsg := "Error configuring vlan: %s"
 	vmName := state.Get("vmName").(string)
@@ -46,7 +48,7 @@ func (s *StepConfigureVlan) Run(state multistep.StateBag) multistep.StepAction {
 	}
 
 	// change vlanid param
-	err := hyperv.SetVirtualMachineVlanId(vmName, s.VlanId)
+	err := hyperv.SetVirtualMachineVlanId(ps, vmName, s.VlanId)
 	if err != nil {
 		err := fmt.Errorf(errorMsg, err)
 		state.Put("error", err)
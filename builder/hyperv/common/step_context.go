@@ -0,0 +1,42 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"context"
+	"github.com/mitchellh/multistep"
+	"time"
+)
+
+// stepContext returns a context that times out after timeout and is
+// also cancelled as soon as the running build is interrupted, so a step
+// blocked inside powershell.Retry actually stops waiting instead of
+// riding out the full timeout.
+func stepContext(state multistep.StateBag, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, ok := state.GetOk(multistep.StateCancelled); ok {
+					cancel()
+					return
+				}
+				if _, ok := state.GetOk(multistep.StateHalted); ok {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,100 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/powershell"
+	"github.com/mitchellh/packer/powershell/hyperv"
+)
+
+type StepCreateVM struct {
+	VMName          string
+	SwitchName      string
+	RamSizeMB       uint
+	DiskSize        uint
+	Generation      uint
+	Cpu             uint
+	EnabeSecureBoot bool
+
+	// DifferencingDisk chains the VM's disk off ParentVhdPath as a
+	// differencing VHDX instead of a fresh dynamic VHDX.
+	DifferencingDisk bool
+	ParentVhdPath    string
+
+	// SecureBootTemplate selects the Generation 2 secure boot template.
+	// Only applied when EnabeSecureBoot is true.
+	SecureBootTemplate string
+	EnableVirtualTPM   bool
+}
+
+func (s *StepCreateVM) Run(state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
+
+	errorMsg := "Error creating vm: %s"
+
+	ui.Say("Creating virtual machine...")
+
+	diskSize := s.DiskSize
+	if s.DifferencingDisk {
+		// The differencing VHDX is created and attached separately below.
+		diskSize = 0
+	}
+
+	err := hyperv.CreateVirtualMachine(ps, s.VMName, s.SwitchName, diskSize, s.RamSizeMB, s.Cpu, s.Generation)
+	if err != nil {
+		err := fmt.Errorf(errorMsg, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if s.DifferencingDisk {
+		ui.Say(fmt.Sprintf("Creating differencing disk from parent %s...", s.ParentVhdPath))
+
+		err = hyperv.CreateDifferencingVhd(ps, s.VMName, s.ParentVhdPath)
+		if err != nil {
+			err := fmt.Errorf(errorMsg, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	if s.Generation == 2 {
+		if s.EnabeSecureBoot && s.SecureBootTemplate != "" {
+			ui.Say(fmt.Sprintf("Setting secure boot template to %s...", s.SecureBootTemplate))
+
+			if err := hyperv.SetSecureBootTemplate(ps, s.VMName, s.SecureBootTemplate); err != nil {
+				err := fmt.Errorf(errorMsg, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		}
+
+		if s.EnableVirtualTPM {
+			ui.Say("Enabling virtual TPM...")
+
+			if err := hyperv.EnableVirtualTPM(ps, s.VMName); err != nil {
+				err := fmt.Errorf(errorMsg, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		}
+	}
+
+	state.Put("vmName", s.VMName)
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCreateVM) Cleanup(state multistep.StateBag) {
+	// do nothing
+}
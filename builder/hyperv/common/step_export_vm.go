@@ -0,0 +1,74 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/powershell"
+	"github.com/mitchellh/packer/powershell/hyperv"
+)
+
+// StepExportVm exports the finished virtual machine to OutputDir.
+type StepExportVm struct {
+	OutputDir      string
+	SkipCompaction bool
+
+	// MergeParent flattens a differencing disk and its parent into a new
+	// standalone VHDX before exporting, instead of exporting a child that
+	// still references its parent. The parent VHDX itself is left
+	// unchanged. Set this whenever the VM was created with
+	// StepCreateVM.DifferencingDisk, unless the parent chain should be
+	// kept intact.
+	MergeParent bool
+}
+
+func (s *StepExportVm) Run(state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
+	vmName := state.Get("vmName").(string)
+
+	errorMsg := "Error exporting vm: %s"
+
+	if s.MergeParent {
+		ui.Say("Merging differencing disk into a standalone disk...")
+
+		if err := hyperv.MergeVirtualHardDisk(ps, vmName); err != nil {
+			err := fmt.Errorf(errorMsg, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	ui.Say("Exporting vm...")
+
+	err := hyperv.ExportVirtualMachine(ps, vmName, s.OutputDir)
+	if err != nil {
+		err := fmt.Errorf(errorMsg, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if !s.SkipCompaction {
+		ui.Say("Compacting disks...")
+
+		err = hyperv.CompactDisks(s.OutputDir)
+		if err != nil {
+			err := fmt.Errorf(errorMsg, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepExportVm) Cleanup(state multistep.StateBag) {
+	// do nothing
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/powershell"
+	"github.com/mitchellh/packer/powershell/hyperv"
+)
+
+// StepImportVM creates the virtual machine for the vhd builder. Instead
+// of booting an installer off an ISO, it either imports an already
+// exported VM (CloneFromVmcxPath) or creates a fresh VM and attaches a
+// pre-existing VHD/VHDX (SourceVhd) as its boot disk.
+type StepImportVM struct {
+	VMName           string
+	SwitchName       string
+	RamSizeMB        uint
+	Cpu              uint
+	Generation       uint
+	EnableSecureBoot bool
+
+	CloneFromVmcxPath string
+	SourceVhd         string
+	Checksum          string
+	ChecksumType      string
+}
+
+func (s *StepImportVM) Run(state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
+
+	errorMsg := "Error importing vm: %s"
+
+	if s.SourceVhd != "" {
+		ui.Say("Verifying checksum of source_vhd...")
+
+		if err := VerifyChecksum(s.SourceVhd, s.ChecksumType, s.Checksum); err != nil {
+			err := fmt.Errorf(errorMsg, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	ui.Say("Importing virtual machine...")
+
+	var err error
+	if s.CloneFromVmcxPath != "" {
+		err = hyperv.ImportVirtualMachine(ps, s.CloneFromVmcxPath, s.VMName, s.SwitchName, s.RamSizeMB, s.Cpu)
+	} else {
+		err = hyperv.CreateVirtualMachine(ps, s.VMName, s.SwitchName, 0, s.RamSizeMB, s.Cpu, s.Generation)
+		if err == nil && s.SourceVhd != "" {
+			err = hyperv.CopyVhdAndAttach(ps, s.VMName, s.SourceVhd)
+		}
+		if err == nil && s.Generation == 2 && s.EnableSecureBoot {
+			err = hyperv.SetSecureBoot(ps, s.VMName, true)
+		}
+	}
+
+	if err != nil {
+		err := fmt.Errorf(errorMsg, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("vmName", s.VMName)
+
+	return multistep.ActionContinue
+}
+
+func (s *StepImportVM) Cleanup(state multistep.StateBag) {
+	// do nothing
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/powershell"
+	"github.com/mitchellh/packer/powershell/hyperv"
+)
+
+// StepSetBootOrder sets the Generation 2 UEFI boot order. It must run
+// after the DVD/floppy/secondary-ISO mount steps, since a Generation 2
+// VM has no DVD drive at creation time and Set-VMFirmware would
+// otherwise silently drop "dvd" from the order.
+type StepSetBootOrder struct {
+	Generation uint
+	BootOrder  []string
+}
+
+func (s *StepSetBootOrder) Run(state multistep.StateBag) multistep.StepAction {
+	if s.Generation != 2 || len(s.BootOrder) == 0 {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
+	vmName := state.Get("vmName").(string)
+
+	ui.Say("Setting boot order...")
+
+	if err := hyperv.SetBootOrder(ps, vmName, s.BootOrder); err != nil {
+		err := fmt.Errorf("Error setting boot order: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepSetBootOrder) Cleanup(state multistep.StateBag) {
+	// do nothing
+}
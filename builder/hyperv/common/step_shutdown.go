@@ -0,0 +1,82 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	powershell "github.com/mitchellh/packer/powershell"
+	"github.com/mitchellh/packer/powershell/hyperv"
+	"time"
+)
+
+// DefaultShutdownTimeout is used when Timeout is zero.
+const DefaultShutdownTimeout = 5 * time.Minute
+
+// StepShutdown initiates shutdown of the VM, either by running Command
+// over the communicator or, if Command is empty, by forcibly stopping
+// the VM. It only triggers the shutdown; StepWaitForPowerOff is
+// responsible for waiting until it actually completes.
+type StepShutdown struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (s *StepShutdown) Run(state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
+	vmName := state.Get("vmName").(string)
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	ctx, cancel := stepContext(state, timeout)
+	defer cancel()
+
+	var err error
+	if s.Command != "" {
+		ui.Say("Gracefully halting virtual machine...")
+
+		comm := state.Get("communicator").(packer.Communicator)
+
+		err = powershell.Retry(ctx, powershell.DefaultRetryPolicy(timeout), func() error {
+			var stdout, stderr bytes.Buffer
+			cmd := &packer.RemoteCmd{
+				Command: s.Command,
+				Stdout:  &stdout,
+				Stderr:  &stderr,
+			}
+
+			if startErr := comm.Start(cmd); startErr != nil {
+				return &powershell.ErrTransientPSRemoting{Err: startErr}
+			}
+
+			return nil
+		})
+	} else {
+		ui.Say("Halting virtual machine...")
+
+		err = powershell.Retry(ctx, powershell.DefaultRetryPolicy(timeout), func() error {
+			return hyperv.StopVirtualMachine(ps, vmName)
+		})
+	}
+
+	if err != nil {
+		err := fmt.Errorf("Error shutting down vm: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepShutdown) Cleanup(state multistep.StateBag) {
+	// do nothing
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package common
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	powershell "github.com/mitchellh/packer/powershell"
+	"github.com/mitchellh/packer/powershell/hyperv"
+	"time"
+)
+
+// DefaultPowerOffTimeout is used when StepWaitForPowerOff.Timeout is
+// zero.
+const DefaultPowerOffTimeout = 5 * time.Minute
+
+// errNotYetOff is a retryable sentinel returned while polling for a VM
+// to reach the "Off" state.
+type errNotYetOff struct {
+	VMName string
+}
+
+func (e errNotYetOff) Error() string {
+	return fmt.Sprintf("virtual machine %q is not powered off yet", e.VMName)
+}
+
+func (e errNotYetOff) Retryable() bool { return true }
+
+// StepWaitForPowerOff waits for the VM to report itself as powered off,
+// which StepShutdown triggers but does not necessarily wait long enough
+// to complete.
+type StepWaitForPowerOff struct {
+	Timeout time.Duration
+}
+
+func (s *StepWaitForPowerOff) Run(state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	ps := state.Get("ps").(powershell.PowerShellCmd)
+	vmName := state.Get("vmName").(string)
+
+	ui.Say("Waiting for virtual machine to shut down...")
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultPowerOffTimeout
+	}
+
+	ctx, cancel := stepContext(state, timeout)
+	defer cancel()
+
+	err := powershell.Retry(ctx, powershell.DefaultRetryPolicy(timeout), func() error {
+		vmState, err := hyperv.GetVirtualMachineState(ps, vmName)
+		if err != nil {
+			return err
+		}
+
+		if vmState != "Off" {
+			return errNotYetOff{vmName}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		err := fmt.Errorf("Error waiting for vm to power off: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepWaitForPowerOff) Cleanup(state multistep.StateBag) {
+	// do nothing
+}
@@ -50,6 +50,7 @@ type Config struct {
 	hypervcommon.SSHConfig      `mapstructure:",squash"`
 	hypervcommon.RunConfig      `mapstructure:",squash"`
 	hypervcommon.ShutdownConfig `mapstructure:",squash"`
+	hypervcommon.ConnectConfig  `mapstructure:",squash"`
 
 	// The size, in megabytes, of the hard disk to create for the VM.
 	// By default, this is 130048 (about 127 GB).
@@ -112,6 +113,27 @@ type Config struct {
 
 	SkipCompaction bool `mapstructure:"skip_compaction"`
 
+	// When set, the VM's disk is a differencing VHDX chained off
+	// parent_vhd_path instead of a fresh dynamic VHDX.
+	DifferencingDisk bool `mapstructure:"differencing_disk"`
+	// The VHD/VHDX to use as the parent of the differencing disk. Only
+	// used when differencing_disk is true.
+	ParentVhdPath string `mapstructure:"parent_vhd_path"`
+	// Merge the differencing disk and its parent into a new standalone
+	// VHDX before exporting; the parent VHDX is left unchanged. Required to produce a self-contained export when
+	// differencing_disk is true.
+	MergeParent bool `mapstructure:"merge_parent"`
+
+	// The Generation 2 UEFI boot order, e.g. ["dvd", "hdd", "net"].
+	BootOrder []string `mapstructure:"boot_order"`
+	// The Generation 2 secure boot template. One of "MicrosoftWindows",
+	// "MicrosoftUEFICertificateAuthority" or "OpenSourceShieldedVM".
+	// Only applied when enable_secure_boot is true.
+	SecureBootTemplate string `mapstructure:"secure_boot_template"`
+	// Provision a key protector and turn on the virtual TPM. Required
+	// for Windows 11, Server 2022 shielded VMs and some PXE-boot builds.
+	EnableVirtualTPM bool `mapstructure:"enable_virtual_tpm"`
+
 	ctx interpolate.Context
 }
 
@@ -136,6 +158,7 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	errs = packer.MultiErrorAppend(errs, b.config.OutputConfig.Prepare(&b.config.ctx, &b.config.PackerConfig)...)
 	errs = packer.MultiErrorAppend(errs, b.config.SSHConfig.Prepare(&b.config.ctx)...)
 	errs = packer.MultiErrorAppend(errs, b.config.ShutdownConfig.Prepare(&b.config.ctx)...)
+	errs = packer.MultiErrorAppend(errs, b.config.ConnectConfig.Prepare(&b.config.ctx)...)
 	warnings := make([]string, 0)
 
 	err = b.checkDiskSize()
@@ -155,8 +178,10 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 	log.Println(fmt.Sprintf("%s: %v", "VMName", b.config.VMName))
 
 	if b.config.SwitchName == "" {
+		ps := b.config.ConnectConfig.PowerShellCmd()
+
 		// no switch name, try to get one attached to a online network adapter
-		onlineSwitchName, err := hyperv.GetExternalOnlineVirtualSwitch()
+		onlineSwitchName, err := hyperv.GetExternalOnlineVirtualSwitch(ps)
 		if onlineSwitchName == "" || err != nil {
 			b.config.SwitchName = fmt.Sprintf("packer-%s", b.config.PackerBuildName)
 		} else {
@@ -183,6 +208,41 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 		}
 	}
 
+	if b.config.DifferencingDisk && b.config.ParentVhdPath == "" {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("parent_vhd_path must be specified when differencing_disk is true"))
+	}
+
+	if b.config.Generation != 2 {
+		if len(b.config.BootOrder) > 0 {
+			errs = packer.MultiErrorAppend(
+				errs, errors.New("boot_order is only supported on generation 2 vms"))
+		}
+		if b.config.EnableVirtualTPM {
+			errs = packer.MultiErrorAppend(
+				errs, errors.New("enable_virtual_tpm is only supported on generation 2 vms"))
+		}
+		if b.config.SecureBootTemplate != "" {
+			errs = packer.MultiErrorAppend(
+				errs, errors.New("secure_boot_template is only supported on generation 2 vms"))
+		}
+	}
+
+	if b.config.SecureBootTemplate != "" {
+		switch b.config.SecureBootTemplate {
+		case "MicrosoftWindows", "MicrosoftUEFICertificateAuthority", "OpenSourceShieldedVM":
+			// good
+		default:
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Unsupported secure_boot_template: %s", b.config.SecureBootTemplate))
+		}
+
+		if !b.config.EnableSecureBoot {
+			errs = packer.MultiErrorAppend(
+				errs, errors.New("enable_secure_boot must be true to use secure_boot_template"))
+		}
+	}
+
 	log.Println(fmt.Sprintf("Using switch %s", b.config.SwitchName))
 	log.Println(fmt.Sprintf("%s: %v", "SwitchName", b.config.SwitchName))
 	log.Println(fmt.Sprintf("Using vlan %s", b.config.VlanId))
@@ -268,8 +328,10 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
 // Run executes a Packer build and returns a packer.Artifact representing
 // a Hyperv appliance.
 func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packer.Artifact, error) {
+	ps := b.config.ConnectConfig.PowerShellCmd()
+
 	// Create the driver that we'll use to communicate with Hyperv
-	driver, err := hypervcommon.NewHypervPS4Driver()
+	driver, err := hypervcommon.NewHypervPS4Driver(ps)
 	if err != nil {
 		return nil, fmt.Errorf("Failed creating Hyper-V driver: %s", err)
 	}
@@ -280,6 +342,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 	state.Put("driver", driver)
 	state.Put("hook", hook)
 	state.Put("ui", ui)
+	state.Put("ps", ps)
 
 	steps := []multistep.Step{
 		&hypervcommon.StepCreateTempDir{},
@@ -299,13 +362,17 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 			SwitchName: b.config.SwitchName,
 		},
 		&hypervcommon.StepCreateVM{
-			VMName:          b.config.VMName,
-			SwitchName:      b.config.SwitchName,
-			RamSizeMB:       b.config.RamSizeMB,
-			DiskSize:        b.config.DiskSize,
-			Generation:      b.config.Generation,
-			Cpu:             b.config.Cpu,
-			EnabeSecureBoot: b.config.EnableSecureBoot,
+			VMName:             b.config.VMName,
+			SwitchName:         b.config.SwitchName,
+			RamSizeMB:          b.config.RamSizeMB,
+			DiskSize:           b.config.DiskSize,
+			Generation:         b.config.Generation,
+			Cpu:                b.config.Cpu,
+			EnabeSecureBoot:    b.config.EnableSecureBoot,
+			DifferencingDisk:   b.config.DifferencingDisk,
+			ParentVhdPath:      b.config.ParentVhdPath,
+			SecureBootTemplate: b.config.SecureBootTemplate,
+			EnableVirtualTPM:   b.config.EnableVirtualTPM,
 		},
 		&hypervcommon.StepConfigureVlan{
 			VlanId: b.config.VlanId,
@@ -322,6 +389,11 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 			Generation: b.config.Generation,
 		},
 
+		&hypervcommon.StepSetBootOrder{
+			Generation: b.config.Generation,
+			BootOrder:  b.config.BootOrder,
+		},
+
 		&hypervcommon.StepRun{
 			BootWait: b.config.BootWait,
 			Headless: b.config.Headless,
@@ -349,7 +421,9 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		},
 
 		// wait for the vm to be powered off
-		&hypervcommon.StepWaitForPowerOff{},
+		&hypervcommon.StepWaitForPowerOff{
+			Timeout: b.config.ShutdownTimeout,
+		},
 
 		// remove the integration services dvd drive
 		// after we power down
@@ -362,6 +436,7 @@ func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packe
 		&hypervcommon.StepExportVm{
 			OutputDir:      b.config.OutputDir,
 			SkipCompaction: b.config.SkipCompaction,
+			MergeParent:    b.config.MergeParent,
 		},
 
 		// the clean up actions for each step will be executed reverse order
@@ -450,7 +525,9 @@ func (b *Builder) checkRamSize() error {
 }
 
 func (b *Builder) checkHostAvailableMemory() string {
-	freeMB := powershell.GetHostAvailableMemory()
+	ps := b.config.ConnectConfig.PowerShellCmd()
+
+	freeMB := powershell.GetHostAvailableMemory(ps)
 
 	if (freeMB - float64(b.config.RamSizeMB)) < LowRam {
 		return fmt.Sprintf("Hyper-V might fail to create a VM if there is not enough free memory in the system.")
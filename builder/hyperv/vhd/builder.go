@@ -0,0 +1,341 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package vhd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mitchellh/multistep"
+	hypervcommon "github.com/mitchellh/packer/builder/hyperv/common"
+	"github.com/mitchellh/packer/common"
+	"github.com/mitchellh/packer/helper/communicator"
+	"github.com/mitchellh/packer/helper/config"
+	"github.com/mitchellh/packer/packer"
+	"github.com/mitchellh/packer/template/interpolate"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRamSize = 1024  // 1GB
+	MinRamSize     = 512   // 512MB
+	MaxRamSize     = 32768 // 32GB
+)
+
+// Builder implements packer.Builder and builds Hyperv images from a
+// pre-existing VHD/VHDX, an exported VM (.vmcx) or another registered
+// VM, without running through an OS install.
+type Builder struct {
+	config Config
+	runner multistep.Runner
+}
+
+type Config struct {
+	common.PackerConfig         `mapstructure:",squash"`
+	hypervcommon.OutputConfig   `mapstructure:",squash"`
+	hypervcommon.SSHConfig      `mapstructure:",squash"`
+	hypervcommon.RunConfig      `mapstructure:",squash"`
+	hypervcommon.ShutdownConfig `mapstructure:",squash"`
+	hypervcommon.ConnectConfig  `mapstructure:",squash"`
+
+	// The name of an already registered virtual machine to clone from.
+	CloneFromVMName string `mapstructure:"clone_from_vm_name"`
+	// The path to a folder produced by Export-VM (or exported through
+	// Hyper-V Manager) containing a .vmcx to import.
+	CloneFromVmcxPath string `mapstructure:"clone_from_vmcx_path"`
+	// The path to an existing VHD or VHDX to attach as the boot disk of
+	// a freshly created VM.
+	SourceVhd string `mapstructure:"source_vhd"`
+
+	// The checksum for the source_vhd file. Because VHD/VHDX files can
+	// be large, this is required whenever source_vhd is used, and
+	// Packer will verify it prior to using the file.
+	Checksum string `mapstructure:"checksum"`
+	// The type of the checksum specified in checksum. Valid values are
+	// "none", "md5", "sha1", "sha256", or "sha512".
+	ChecksumType string `mapstructure:"checksum_type"`
+
+	// The size, in megabytes, of the computer memory in the VM.
+	// By default, this is 1024 (about 1 GB).
+	RamSizeMB uint `mapstructure:"ram_size_mb"`
+
+	// This is the name of the new virtual machine.
+	// By default this is "packer-BUILDNAME", where "BUILDNAME" is the name of the build.
+	VMName string `mapstructure:"vm_name"`
+
+	SwitchName       string `mapstructure:"switch_name"`
+	VlanId           string `mapstructure:"vlan_id"`
+	Cpu              uint   `mapstructure:"cpu"`
+	Generation       uint   `mapstructure:"generation"`
+	EnableSecureBoot bool   `mapstructure:"enable_secure_boot"`
+
+	Communicator string `mapstructure:"communicator"`
+
+	// The time to wait for the virtual machine to report an IP address.
+	// None of this builder's steps read this setting, so it has no effect
+	// on the build.
+	IPAddressTimeout time.Duration `mapstructure:"ip_address_timeout"`
+
+	SSHWaitTimeout time.Duration
+
+	SkipCompaction bool `mapstructure:"skip_compaction"`
+
+	ctx interpolate.Context
+}
+
+// Prepare processes the build configuration parameters.
+func (b *Builder) Prepare(raws ...interface{}) ([]string, error) {
+	err := config.Decode(&b.config, &config.DecodeOpts{
+		Interpolate: true,
+	}, raws...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Accumulate any errors and warnings
+	var errs *packer.MultiError
+	errs = packer.MultiErrorAppend(errs, b.config.RunConfig.Prepare(&b.config.ctx)...)
+	errs = packer.MultiErrorAppend(errs, b.config.OutputConfig.Prepare(&b.config.ctx, &b.config.PackerConfig)...)
+	errs = packer.MultiErrorAppend(errs, b.config.SSHConfig.Prepare(&b.config.ctx)...)
+	errs = packer.MultiErrorAppend(errs, b.config.ShutdownConfig.Prepare(&b.config.ctx)...)
+	errs = packer.MultiErrorAppend(errs, b.config.ConnectConfig.Prepare(&b.config.ctx)...)
+	warnings := make([]string, 0)
+
+	err = b.checkRamSize()
+	if err != nil {
+		errs = packer.MultiErrorAppend(errs, err)
+	}
+
+	if b.config.VMName == "" {
+		b.config.VMName = fmt.Sprintf("packer-%s", b.config.PackerBuildName)
+	}
+
+	log.Println(fmt.Sprintf("%s: %v", "VMName", b.config.VMName))
+
+	if b.config.SwitchName == "" {
+		b.config.SwitchName = fmt.Sprintf("packer-%s", b.config.PackerBuildName)
+	}
+
+	if b.config.Cpu < 1 {
+		b.config.Cpu = 1
+	}
+
+	if b.config.Generation != 2 {
+		b.config.Generation = 1
+	}
+
+	// Exactly one source must be given.
+	sources := 0
+	if b.config.CloneFromVMName != "" {
+		sources++
+	}
+	if b.config.CloneFromVmcxPath != "" {
+		sources++
+	}
+	if b.config.SourceVhd != "" {
+		sources++
+	}
+
+	if sources == 0 {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("One of clone_from_vm_name, clone_from_vmcx_path or source_vhd must be specified."))
+	} else if sources > 1 {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("Only one of clone_from_vm_name, clone_from_vmcx_path or source_vhd may be specified."))
+	}
+
+	if b.config.EnableSecureBoot && b.config.Generation != 2 {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("enable_secure_boot is only supported on generation 2 vms"))
+	}
+
+	if b.config.SourceVhd != "" {
+		if b.config.ChecksumType == "" {
+			errs = packer.MultiErrorAppend(
+				errs, errors.New("The checksum_type must be specified."))
+		} else {
+			b.config.ChecksumType = strings.ToLower(b.config.ChecksumType)
+			if b.config.ChecksumType != "none" {
+				if b.config.Checksum == "" {
+					errs = packer.MultiErrorAppend(
+						errs, errors.New("Due to large file sizes, a checksum is required for source_vhd"))
+				} else {
+					b.config.Checksum = strings.ToLower(b.config.Checksum)
+				}
+
+				if h := common.HashForType(b.config.ChecksumType); h == nil {
+					errs = packer.MultiErrorAppend(
+						errs,
+						fmt.Errorf("Unsupported checksum type: %s", b.config.ChecksumType))
+				}
+			}
+		}
+	}
+
+	if b.config.Communicator == "" {
+		b.config.Communicator = "ssh"
+	} else if b.config.Communicator == "ssh" || b.config.Communicator == "winrm" {
+		// good
+	} else {
+		errs = packer.MultiErrorAppend(errs, errors.New("communicator must be either ssh or winrm"))
+	}
+
+	if b.config.ShutdownCommand == "" {
+		warnings = append(warnings,
+			"A shutdown_command was not specified. Without a shutdown command, Packer\n"+
+				"will forcibly halt the virtual machine, which may result in data loss.")
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return warnings, errs
+	}
+
+	return warnings, nil
+}
+
+// Run executes a Packer build and returns a packer.Artifact representing
+// a Hyperv appliance.
+func (b *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (packer.Artifact, error) {
+	ps := b.config.ConnectConfig.PowerShellCmd()
+
+	// Create the driver that we'll use to communicate with Hyperv
+	driver, err := hypervcommon.NewHypervPS4Driver(ps)
+	if err != nil {
+		return nil, fmt.Errorf("Failed creating Hyper-V driver: %s", err)
+	}
+
+	// Set up the state.
+	state := new(multistep.BasicStateBag)
+	state.Put("config", &b.config)
+	state.Put("driver", driver)
+	state.Put("hook", hook)
+	state.Put("ui", ui)
+	state.Put("ps", ps)
+
+	var createStep multistep.Step
+	switch {
+	case b.config.CloneFromVMName != "":
+		createStep = &hypervcommon.StepCloneVM{
+			CloneFromVMName: b.config.CloneFromVMName,
+			VMName:          b.config.VMName,
+			SwitchName:      b.config.SwitchName,
+			RamSizeMB:       b.config.RamSizeMB,
+			Cpu:             b.config.Cpu,
+		}
+	default:
+		createStep = &hypervcommon.StepImportVM{
+			VMName:            b.config.VMName,
+			SwitchName:        b.config.SwitchName,
+			RamSizeMB:         b.config.RamSizeMB,
+			Cpu:               b.config.Cpu,
+			Generation:        b.config.Generation,
+			EnableSecureBoot:  b.config.EnableSecureBoot,
+			CloneFromVmcxPath: b.config.CloneFromVmcxPath,
+			SourceVhd:         b.config.SourceVhd,
+			Checksum:          b.config.Checksum,
+			ChecksumType:      b.config.ChecksumType,
+		}
+	}
+
+	steps := []multistep.Step{
+		&hypervcommon.StepCreateTempDir{},
+		&hypervcommon.StepOutputDir{
+			Force: b.config.PackerForce,
+			Path:  b.config.OutputDir,
+		},
+		&hypervcommon.StepCreateSwitch{
+			SwitchName: b.config.SwitchName,
+		},
+		createStep,
+		&hypervcommon.StepConfigureVlan{
+			VlanId: b.config.VlanId,
+		},
+		&hypervcommon.StepEnableIntegrationService{},
+
+		&hypervcommon.StepRun{
+			BootWait: b.config.BootWait,
+			Headless: b.config.Headless,
+		},
+
+		// configure the communicator ssh, winrm
+		&communicator.StepConnect{
+			Config:    &b.config.SSHConfig.Comm,
+			Host:      hypervcommon.CommHost,
+			SSHConfig: hypervcommon.SSHConfigFunc(&b.config.SSHConfig),
+		},
+
+		// provision requires communicator to be setup
+		&common.StepProvision{},
+
+		&hypervcommon.StepShutdown{
+			Command: b.config.ShutdownCommand,
+			Timeout: b.config.ShutdownTimeout,
+		},
+
+		// wait for the vm to be powered off
+		&hypervcommon.StepWaitForPowerOff{
+			Timeout: b.config.ShutdownTimeout,
+		},
+
+		&hypervcommon.StepExportVm{
+			OutputDir:      b.config.OutputDir,
+			SkipCompaction: b.config.SkipCompaction,
+		},
+
+		// the clean up actions for each step will be executed reverse order
+	}
+
+	// Run the steps.
+	if b.config.PackerDebug {
+		b.runner = &multistep.DebugRunner{
+			Steps:   steps,
+			PauseFn: common.MultistepDebugFn(ui),
+		}
+	} else {
+		b.runner = &multistep.BasicRunner{Steps: steps}
+	}
+	b.runner.Run(state)
+
+	// Report any errors.
+	if rawErr, ok := state.GetOk("error"); ok {
+		return nil, rawErr.(error)
+	}
+
+	// If we were interrupted or cancelled, then just exit.
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		return nil, errors.New("Build was cancelled.")
+	}
+
+	if _, ok := state.GetOk(multistep.StateHalted); ok {
+		return nil, errors.New("Build was halted.")
+	}
+
+	return hypervcommon.NewArtifact(b.config.OutputDir)
+}
+
+// Cancel.
+func (b *Builder) Cancel() {
+	if b.runner != nil {
+		log.Println("Cancelling the step runner...")
+		b.runner.Cancel()
+	}
+}
+
+func (b *Builder) checkRamSize() error {
+	if b.config.RamSizeMB == 0 {
+		b.config.RamSizeMB = DefaultRamSize
+	}
+
+	log.Println(fmt.Sprintf("%s: %v", "RamSize", b.config.RamSizeMB))
+
+	if b.config.RamSizeMB < MinRamSize {
+		return fmt.Errorf("ram_size_mb: Windows server requires memory size >= %v MB, but defined: %v", MinRamSize, b.config.RamSizeMB)
+	} else if b.config.RamSizeMB > MaxRamSize {
+		return fmt.Errorf("ram_size_mb: Windows server requires memory size <= %v MB, but defined: %v", MaxRamSize, b.config.RamSizeMB)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package powershell
+
+import "fmt"
+
+// ErrVMNotFound indicates the requested virtual machine does not exist
+// on the Hyper-V host, or not yet (for example, right after it was
+// created and has not shown up in an enumeration call).
+type ErrVMNotFound struct {
+	VMName string
+}
+
+func (e *ErrVMNotFound) Error() string {
+	return fmt.Sprintf("virtual machine %q not found", e.VMName)
+}
+
+// Retryable reports whether the error is worth retrying. A missing VM
+// may simply not have registered with the host yet.
+func (e *ErrVMNotFound) Retryable() bool { return true }
+
+// ErrNoGuestIP indicates the VM's network adapter has not yet reported
+// a guest IP address.
+type ErrNoGuestIP struct {
+	VMName string
+}
+
+func (e *ErrNoGuestIP) Error() string {
+	return fmt.Sprintf("virtual machine %q has not reported an ip address yet", e.VMName)
+}
+
+func (e *ErrNoGuestIP) Retryable() bool { return true }
+
+// ErrIntegrationServiceUnavailable indicates a required Hyper-V
+// integration service is not available in the guest yet.
+type ErrIntegrationServiceUnavailable struct {
+	VMName  string
+	Service string
+}
+
+func (e *ErrIntegrationServiceUnavailable) Error() string {
+	return fmt.Sprintf("integration service %q is not available on %q yet", e.Service, e.VMName)
+}
+
+func (e *ErrIntegrationServiceUnavailable) Retryable() bool { return true }
+
+// ErrTransientPSRemoting indicates a PowerShell (local or remote)
+// invocation failed for a reason likely to clear up on its own, such as
+// a dropped WinRM connection or a busy runspace.
+type ErrTransientPSRemoting struct {
+	Err error
+}
+
+func (e *ErrTransientPSRemoting) Error() string {
+	return fmt.Sprintf("transient PowerShell remoting error: %s", e.Err)
+}
+
+func (e *ErrTransientPSRemoting) Retryable() bool { return true }
+
+// ErrPSRemotingUnavailable indicates Packer could not even establish a
+// WinRM/PSRP session with the Hyper-V host, for example because of bad
+// credentials or an unreachable endpoint. Unlike ErrTransientPSRemoting,
+// retrying this blindly would not help.
+type ErrPSRemotingUnavailable struct {
+	Host string
+	Err  error
+}
+
+func (e *ErrPSRemotingUnavailable) Error() string {
+	return fmt.Sprintf("could not establish PowerShell remoting with %s: %s", e.Host, e.Err)
+}
+
+func (e *ErrPSRemotingUnavailable) Retryable() bool { return false }
@@ -0,0 +1,101 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package hyperv
+
+import (
+	"fmt"
+	powershell "github.com/mitchellh/packer/powershell"
+)
+
+// CreateVirtualMachine creates a new virtual machine named vmName,
+// connected to switchName. Unless diskSize is 0, a fresh dynamic VHDX
+// of diskSize megabytes is created and attached as the boot disk; pass
+// 0 to create a bare VM so the caller can attach a disk itself, for
+// example a differencing disk or an imported VHD.
+func CreateVirtualMachine(ps powershell.PowerShellCmd, vmName string, switchName string, diskSize uint, ramSizeMB uint, cpu uint, generation uint) error {
+	var script = `
+param([string]$vmName, [string]$switchName, [int]$diskSize, [int]$ramSizeMB, [int]$cpu, [int]$generation)
+
+$vmPath = Join-Path $env:TEMP $vmName
+New-Item -ItemType Directory -Path $vmPath -Force | Out-Null
+
+$vhdPath = ""
+if ($diskSize -gt 0) {
+    $vhdPath = Join-Path $vmPath ($vmName + ".vhdx")
+    New-VHD -Path $vhdPath -SizeBytes ([int64]$diskSize * 1MB) -Dynamic | Out-Null
+}
+
+$vmParams = @{
+    Name = $vmName
+    Path = $vmPath
+    MemoryStartupBytes = ([int64]$ramSizeMB * 1MB)
+    Generation = $generation
+}
+if ($vhdPath -ne "") {
+    $vmParams.VHDPath = $vhdPath
+}
+
+$vm = New-VM @vmParams
+Set-VMProcessor $vm -Count $cpu
+
+if ($switchName -ne "") {
+    Get-VMNetworkAdapter -VM $vm | Connect-VMNetworkAdapter -SwitchName $switchName
+}
+`
+
+	_, err := ps.Output(script, vmName, switchName, fmt.Sprintf("%v", diskSize), fmt.Sprintf("%v", ramSizeMB), fmt.Sprintf("%v", cpu), fmt.Sprintf("%v", generation))
+	return err
+}
+
+// CreateDifferencingVhd creates a new differencing VHDX chained off
+// parentVhdPath and attaches it to vmName, so the build only stores the
+// delta from parentVhdPath instead of re-creating the whole disk.
+func CreateDifferencingVhd(ps powershell.PowerShellCmd, vmName string, parentVhdPath string) error {
+	var script = `
+param([string]$vmName, [string]$parentVhdPath)
+
+$vm = Get-VM -Name $vmName
+$destDir = Join-Path $vm.ConfigurationLocation "Virtual Hard Disks"
+New-Item -ItemType Directory -Path $destDir -Force | Out-Null
+
+$destPath = Join-Path $destDir ($vmName + ".vhdx")
+New-VHD -Path $destPath -ParentPath $parentVhdPath -Differencing | Out-Null
+
+Add-VMHardDiskDrive -VMName $vmName -Path $destPath
+`
+
+	_, err := ps.Output(script, vmName, parentVhdPath)
+	return err
+}
+
+// MergeVirtualHardDisk merges vmName's differencing VHDX into a new,
+// standalone VHDX and re-attaches that in its place, so the VM no
+// longer depends on the differencing child. The merge target is a new
+// file next to the child disk, never the shared parent VHDX, so other
+// builds can keep differencing off that same parent. Required before
+// exporting a VM built from a differencing disk, unless the caller
+// wants to keep the parent/child chain intact.
+func MergeVirtualHardDisk(ps powershell.PowerShellCmd, vmName string) error {
+	var script = `
+param([string]$vmName)
+
+$disk = Get-VMHardDiskDrive -VMName $vmName | Select-Object -First 1
+$vhdInfo = Get-VHD -Path $disk.Path
+
+if ([string]::IsNullOrEmpty($vhdInfo.ParentPath)) {
+    return
+}
+
+$mergedPath = Join-Path (Split-Path $disk.Path) ([System.IO.Path]::GetFileNameWithoutExtension($disk.Path) + "-merged.vhdx")
+
+Convert-VHD -Path $disk.Path -DestinationPath $mergedPath -VHDType Dynamic
+Remove-VMHardDiskDrive -VMHardDiskDrive $disk
+Remove-Item -Path $disk.Path -Force
+Add-VMHardDiskDrive -VMName $vmName -Path $mergedPath
+`
+
+	_, err := ps.Output(script, vmName)
+	return err
+}
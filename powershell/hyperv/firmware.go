@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package hyperv
+
+import (
+	"fmt"
+	powershell "github.com/mitchellh/packer/powershell"
+	"strings"
+)
+
+// SetBootOrder sets the UEFI boot order of a Generation 2 VM. Valid
+// entries are "dvd", "hdd" and "net".
+func SetBootOrder(ps powershell.PowerShellCmd, vmName string, bootOrder []string) error {
+	var script = `
+param([string]$vmName, [string]$bootOrder)
+
+$devices = @()
+foreach ($kind in ($bootOrder -split ",")) {
+    switch ($kind) {
+        "dvd" { $devices += Get-VMDvdDrive -VMName $vmName }
+        "hdd" { $devices += Get-VMHardDiskDrive -VMName $vmName }
+        "net" { $devices += Get-VMNetworkAdapter -VMName $vmName }
+    }
+}
+
+Set-VMFirmware -VMName $vmName -BootOrder $devices
+`
+
+	_, err := ps.Output(script, vmName, strings.Join(bootOrder, ","))
+	return err
+}
+
+// SetSecureBoot turns secure boot on or off for a Generation 2 VM,
+// using whatever secure boot template is already configured.
+func SetSecureBoot(ps powershell.PowerShellCmd, vmName string, enable bool) error {
+	var script = `
+param([string]$vmName, [string]$enable)
+Set-VMFirmware -VMName $vmName -EnableSecureBoot $enable
+`
+
+	state := "Off"
+	if enable {
+		state = "On"
+	}
+
+	_, err := ps.Output(script, vmName, state)
+	return err
+}
+
+// SetSecureBootTemplate sets the secure boot template used by a
+// Generation 2 VM's firmware, e.g. "MicrosoftWindows",
+// "MicrosoftUEFICertificateAuthority" or "OpenSourceShieldedVM".
+func SetSecureBootTemplate(ps powershell.PowerShellCmd, vmName string, template string) error {
+	var script = `
+param([string]$vmName, [string]$template)
+Set-VMFirmware -VMName $vmName -EnableSecureBoot On -SecureBootTemplate $template
+`
+
+	_, err := ps.Output(script, vmName, template)
+	if err != nil {
+		return fmt.Errorf("Error setting secure boot template %q: %s", template, err)
+	}
+
+	return nil
+}
+
+// EnableVirtualTPM provisions a key protector and enables the virtual
+// TPM for a Generation 2 VM, which is required for Windows 11 and
+// shielded VMs.
+func EnableVirtualTPM(ps powershell.PowerShellCmd, vmName string) error {
+	var script = `
+param([string]$vmName)
+
+if ((Get-VM -Name $vmName).KeyProtectorStatus -eq [Microsoft.HyperV.PowerShell.VMLocalKeyProtectorStatus]::None) {
+    Set-VMKeyProtector -VMName $vmName -NewLocalKeyProtector
+}
+
+Enable-VMTPM -VMName $vmName
+`
+
+	_, err := ps.Output(script, vmName)
+	return err
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package hyperv
+
+import (
+	"fmt"
+	powershell "github.com/mitchellh/packer/powershell"
+)
+
+// ImportVirtualMachine imports a virtual machine from an exported VM
+// folder (a .vmcx configuration produced by Export-VM or Hyper-V
+// Manager), renames it to vmName and, if switchName is given, connects
+// it to that switch. The import is always a copy so the source folder
+// is left untouched and can be reused for further imports.
+func ImportVirtualMachine(ps powershell.PowerShellCmd, vmcxPath string, vmName string, switchName string, ramSizeMB uint, cpu uint) error {
+	var script = `
+param([string]$vmcxPath, [string]$vmName, [string]$switchName, [int]$ramSizeMB, [int]$cpu)
+
+if (Test-Path -Path $vmcxPath -PathType Container) {
+    $vmcxPath = Get-ChildItem -Path $vmcxPath -Filter *.vmcx -Recurse | Select-Object -First 1 -ExpandProperty FullName
+}
+
+$vm = (Import-VM -Path $vmcxPath -Copy -GenerateNewId)[0]
+Rename-VM -VM $vm -NewName $vmName
+
+Set-VMMemory $vm -StartupBytes ($ramSizeMB * 1024 * 1024)
+Set-VMProcessor $vm -Count $cpu
+
+if ($switchName -ne "") {
+    Get-VMNetworkAdapter -VM $vm | Connect-VMNetworkAdapter -SwitchName $switchName
+}
+`
+
+	_, err := ps.Output(script, vmcxPath, vmName, switchName, fmt.Sprintf("%v", ramSizeMB), fmt.Sprintf("%v", cpu))
+	return err
+}
+
+// CloneVirtualMachine clones an already registered virtual machine
+// (sourceVMName) into a new VM (vmName) by exporting and re-importing
+// it, so that the clone gets its own VM id and can run side by side
+// with the source. The clone is a full copy that does not depend on the
+// source's disks, as opposed to CopyVhdAndAttach which only clones a
+// disk.
+func CloneVirtualMachine(ps powershell.PowerShellCmd, sourceVMName string, vmName string, switchName string, ramSizeMB uint, cpu uint) error {
+	var script = `
+param([string]$sourceVMName, [string]$vmName, [string]$switchName, [int]$ramSizeMB, [int]$cpu)
+
+$exportPath = Join-Path $env:TEMP ([System.Guid]::NewGuid().ToString())
+Export-VM -Name $sourceVMName -Path $exportPath
+
+$vmcxPath = Get-ChildItem -Path $exportPath -Filter *.vmcx -Recurse | Select-Object -First 1 -ExpandProperty FullName
+$vm = (Import-VM -Path $vmcxPath -Copy -GenerateNewId)[0]
+Rename-VM -VM $vm -NewName $vmName
+
+Set-VMMemory $vm -StartupBytes ($ramSizeMB * 1024 * 1024)
+Set-VMProcessor $vm -Count $cpu
+
+if ($switchName -ne "") {
+    Get-VMNetworkAdapter -VM $vm | Connect-VMNetworkAdapter -SwitchName $switchName
+}
+
+Remove-Item -Path $exportPath -Recurse -Force
+`
+
+	_, err := ps.Output(script, sourceVMName, vmName, switchName, fmt.Sprintf("%v", ramSizeMB), fmt.Sprintf("%v", cpu))
+	return err
+}
+
+// CopyVhdAndAttach copies sourceVhdPath into vmName's default virtual
+// hard disk folder and attaches it as the VM's boot disk. It is used
+// to seed a freshly created VM with a pre-existing VHD/VHDX without
+// going through an OS install.
+func CopyVhdAndAttach(ps powershell.PowerShellCmd, vmName string, sourceVhdPath string) error {
+	var script = `
+param([string]$vmName, [string]$sourceVhdPath)
+
+$vm = Get-VM -Name $vmName
+$destDir = Join-Path $vm.ConfigurationLocation "Virtual Hard Disks"
+New-Item -ItemType Directory -Path $destDir -Force | Out-Null
+
+$destPath = Join-Path $destDir (Split-Path $sourceVhdPath -Leaf)
+Copy-Item -Path $sourceVhdPath -Destination $destPath -Force
+
+Add-VMHardDiskDrive -VMName $vmName -Path $destPath
+`
+
+	_, err := ps.Output(script, vmName, sourceVhdPath)
+	return err
+}
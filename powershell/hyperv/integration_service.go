@@ -0,0 +1,21 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package hyperv
+
+import (
+	powershell "github.com/mitchellh/packer/powershell"
+)
+
+// GetIntegrationServiceState returns the PrimaryStatusDescription of the
+// named Hyper-V integration service (e.g. "Heartbeat"), or "" if the
+// guest hasn't reported one yet.
+func GetIntegrationServiceState(ps powershell.PowerShellCmd, vmName string, service string) (string, error) {
+	var script = `
+param([string]$vmName, [string]$service)
+(Get-VMIntegrationService -VMName $vmName -Name $service).PrimaryStatusDescription
+`
+
+	return ps.Output(script, vmName, service)
+}
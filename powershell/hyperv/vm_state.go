@@ -0,0 +1,46 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package hyperv
+
+import (
+	"strings"
+
+	powershell "github.com/mitchellh/packer/powershell"
+)
+
+// GetVirtualMachineState returns vmName's current State, e.g. "Off",
+// "Running" or "Saved". It returns *powershell.ErrVMNotFound if vmName
+// does not (yet) show up in the host's VM list.
+func GetVirtualMachineState(ps powershell.PowerShellCmd, vmName string) (string, error) {
+	var script = `
+param([string]$vmName)
+$vm = Get-VM -Name $vmName -ErrorAction SilentlyContinue
+if ($vm -eq $null) { return "" }
+$vm.State
+`
+
+	out, err := ps.Output(script, vmName)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(out) == "" {
+		return "", &powershell.ErrVMNotFound{VMName: vmName}
+	}
+
+	return out, nil
+}
+
+// StopVirtualMachine forcibly turns vmName off, equivalent to pulling
+// the power on a physical machine.
+func StopVirtualMachine(ps powershell.PowerShellCmd, vmName string) error {
+	var script = `
+param([string]$vmName)
+Stop-VM -Name $vmName -TurnOff -Force
+`
+
+	_, err := ps.Output(script, vmName)
+	return err
+}
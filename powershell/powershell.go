@@ -0,0 +1,153 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package powershell
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/masterzen/winrm"
+)
+
+// Runner executes a PowerShell script together with its positional
+// parameters and returns its trimmed standard output.
+type Runner interface {
+	Output(script string, params ...string) (string, error)
+}
+
+// PowerShellCmd describes how PowerShell should be executed for a build.
+// The zero value runs locally via powershell.exe, which is the
+// historical behavior and requires Packer to run on the Hyper-V host
+// itself. Setting Host switches to a WinRM/PSRP runner so a build can
+// target a remote Hyper-V host from a Linux/macOS control machine.
+type PowerShellCmd struct {
+	Host     string
+	Username string
+	Password string
+	UseSSL   bool
+}
+
+// Output runs script, passing params as positional arguments to its
+// param block, and returns the trimmed contents of stdout.
+func (p PowerShellCmd) Output(script string, params ...string) (string, error) {
+	return p.runner().Output(script, params...)
+}
+
+func (p PowerShellCmd) runner() Runner {
+	if p.Host == "" {
+		return new(localRunner)
+	}
+
+	return &psrpRunner{
+		Host:     p.Host,
+		Username: p.Username,
+		Password: p.Password,
+		UseSSL:   p.UseSSL,
+	}
+}
+
+// localRunner shells out to powershell.exe on the machine Packer is
+// running on.
+type localRunner struct{}
+
+func (r *localRunner) Output(script string, params ...string) (string, error) {
+	f, err := ioutil.TempFile("", "packer-ps")
+	if err != nil {
+		return "", err
+	}
+	scriptPath := f.Name() + ".ps1"
+	f.Close()
+	os.Remove(f.Name())
+	defer os.Remove(scriptPath)
+
+	if err := ioutil.WriteFile(scriptPath, []byte(script), 0600); err != nil {
+		return "", err
+	}
+
+	args := append([]string{"-ExecutionPolicy", "Bypass", "-File", scriptPath}, params...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("powershell", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return "", errors.New(strings.TrimSpace(stderr.String()))
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// psrpRunner executes PowerShell remotely over WinRM/PSRP against a
+// Hyper-V host, so Packer can run from a Linux/macOS control machine.
+type psrpRunner struct {
+	Host     string
+	Username string
+	Password string
+	UseSSL   bool
+}
+
+func (r *psrpRunner) Output(script string, params ...string) (string, error) {
+	port := 5985
+	if r.UseSSL {
+		port = 5986
+	}
+
+	endpoint := winrm.NewEndpoint(r.Host, port, r.UseSSL, false, nil, nil, nil, 0)
+
+	client, err := winrm.NewClient(endpoint, r.Username, r.Password)
+	if err != nil {
+		return "", &ErrPSRemotingUnavailable{Host: r.Host, Err: err}
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := client.Run(encodeCommand(script, params), &stdout, &stderr)
+	if err != nil {
+		return "", &ErrTransientPSRemoting{Err: err}
+	}
+
+	if exitCode != 0 {
+		return "", fmt.Errorf("Remote PowerShell on %s exited %d: %s", r.Host, exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// encodeCommand bundles script and its positional parameters into a
+// single -EncodedCommand invocation, since a PSRP shell runs one command
+// string rather than a script file with arguments. script is wrapped as
+// a script block and invoked with the quoted params as trailing
+// arguments, so it binds to script's param(...) block exactly like
+// localRunner's -File params do.
+func encodeCommand(script string, params []string) string {
+	quoted := make([]string, len(params))
+	for i, p := range params {
+		quoted[i] = "'" + strings.Replace(p, "'", "''", -1) + "'"
+	}
+
+	full := "& {" + script + "}"
+	if len(quoted) > 0 {
+		full += " " + strings.Join(quoted, " ")
+	}
+
+	utf16Chars := utf16.Encode([]rune(full))
+	buf := make([]byte, len(utf16Chars)*2)
+	for i, r := range utf16Chars {
+		buf[i*2] = byte(r)
+		buf[i*2+1] = byte(r >> 8)
+	}
+
+	return "powershell -NoProfile -EncodedCommand " + base64.StdEncoding.EncodeToString(buf)
+}
@@ -2,7 +2,10 @@ package powershell
 
 import (
 	"bytes"
+	"encoding/base64"
+	"strings"
 	"testing"
+	"unicode/utf16"
 )
 
 func TestOutput(t *testing.T) {
@@ -50,3 +53,61 @@ func TestRunFile(t *testing.T) {
 		t.Fatalf("output '%v' is not 'a b 15'", cmdOut)
 	}
 }
+
+func decodeCommand(t *testing.T, encoded string) string {
+	t.Helper()
+
+	const prefix = "powershell -NoProfile -EncodedCommand "
+	if !strings.HasPrefix(encoded, prefix) {
+		t.Fatalf("expected command to start with %q, got %q", prefix, encoded)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded[len(prefix):])
+	if err != nil {
+		t.Fatalf("invalid base64: %s", err)
+	}
+
+	u16 := make([]uint16, len(raw)/2)
+	for i := range u16 {
+		u16[i] = uint16(raw[i*2]) | uint16(raw[i*2+1])<<8
+	}
+
+	return string(utf16.Decode(u16))
+}
+
+func TestEncodeCommand_BindsParamsToScriptBlock(t *testing.T) {
+	script := "\nparam([string]$vmName)\n$vmName\n"
+	got := decodeCommand(t, encodeCommand(script, []string{"my-vm"}))
+
+	want := "& {" + script + "} 'my-vm'"
+	if got != want {
+		t.Fatalf("encodeCommand output = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeCommand_MultipleParamsStayPositional(t *testing.T) {
+	got := decodeCommand(t, encodeCommand("param([string]$a, [string]$b)", []string{"one", "two"}))
+
+	want := "& {param([string]$a, [string]$b)} 'one' 'two'"
+	if got != want {
+		t.Fatalf("encodeCommand output = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeCommand_EscapesSingleQuotes(t *testing.T) {
+	got := decodeCommand(t, encodeCommand("param([string]$x)", []string{"it's"}))
+
+	if !strings.Contains(got, "'it''s'") {
+		t.Fatalf("expected escaped quote in %q", got)
+	}
+}
+
+func TestEncodeCommand_NoParams(t *testing.T) {
+	script := "Get-Date"
+	got := decodeCommand(t, encodeCommand(script, nil))
+
+	want := "& {" + script + "}"
+	if got != want {
+		t.Fatalf("encodeCommand output = %q, want %q", got, want)
+	}
+}
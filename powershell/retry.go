@@ -0,0 +1,88 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package powershell
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures the exponential backoff used by Retry.
+type RetryPolicy struct {
+	// InitialInterval is the delay before the second attempt.
+	InitialInterval time.Duration
+	// MaxInterval caps how large the backoff is allowed to grow.
+	MaxInterval time.Duration
+	// MaxElapsedTime bounds the total time Retry will spend retrying,
+	// in addition to whatever deadline ctx already carries. Zero means
+	// no additional bound.
+	MaxElapsedTime time.Duration
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with sensible backoff bounds
+// for an operation that should give up after timeout.
+func DefaultRetryPolicy(timeout time.Duration) RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: 2 * time.Second,
+		MaxInterval:     30 * time.Second,
+		MaxElapsedTime:  timeout,
+	}
+}
+
+// retryable is implemented by errors that know whether retrying them is
+// worthwhile. An error that does not implement it, or returns false, is
+// treated as permanent and returned immediately.
+type retryable interface {
+	Retryable() bool
+}
+
+// Retry calls fn until it succeeds, returns a non-retryable error, ctx
+// is cancelled, or policy.MaxElapsedTime elapses. Between attempts it
+// waits with exponential backoff and jitter.
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	interval := policy.InitialInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var deadline time.Time
+	if policy.MaxElapsedTime > 0 {
+		deadline = time.Now().Add(policy.MaxElapsedTime)
+	}
+
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		// Only errors that explicitly mark themselves retryable get
+		// another attempt. An error of an unrecognized type is assumed
+		// permanent (a bad script, bad credentials, ...) and is
+		// returned immediately rather than burning the whole timeout.
+		r, ok := err.(retryable)
+		if !ok || !r.Retryable() {
+			return err
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return err
+		}
+
+		wait := interval + time.Duration(rand.Int63n(int64(interval)/2+1))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		interval *= 2
+		if interval > policy.MaxInterval {
+			interval = policy.MaxInterval
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) Microsoft Open Technologies, Inc.
+// All Rights Reserved.
+// Licensed under the Apache License, Version 2.0.
+// See License.txt in the project root for license information.
+package powershell
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeRetryableErr struct {
+	retryable bool
+}
+
+func (e fakeRetryableErr) Error() string   { return "fake error" }
+func (e fakeRetryableErr) Retryable() bool { return e.retryable }
+
+func TestRetry_SucceedsAfterNAttempts(t *testing.T) {
+	attempts := 0
+	err := Retry(context.Background(), RetryPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     2 * time.Millisecond,
+		MaxElapsedTime:  time.Second,
+	}, func() error {
+		attempts++
+		if attempts < 3 {
+			return fakeRetryableErr{retryable: true}
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("expected success, got %s", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetry_NonRetryableStopsImmediately(t *testing.T) {
+	attempts := 0
+	wantErr := fakeRetryableErr{retryable: false}
+
+	err := Retry(context.Background(), RetryPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     2 * time.Millisecond,
+		MaxElapsedTime:  time.Second,
+	}, func() error {
+		attempts++
+		return wantErr
+	})
+
+	if err != wantErr {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected exactly 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetry_UntypedErrorStopsImmediately(t *testing.T) {
+	attempts := 0
+	wantErr := errors.New("boom")
+
+	err := Retry(context.Background(), RetryPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     2 * time.Millisecond,
+		MaxElapsedTime:  time.Second,
+	}, func() error {
+		attempts++
+		return wantErr
+	})
+
+	if err != wantErr {
+		t.Fatalf("expected %v, got %v", wantErr, err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected exactly 1 attempt for an error with no Retryable method, got %d", attempts)
+	}
+}
+
+func TestRetry_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	err := Retry(ctx, RetryPolicy{
+		InitialInterval: 10 * time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+		MaxElapsedTime:  time.Minute,
+	}, func() error {
+		attempts++
+		return fakeRetryableErr{retryable: true}
+	})
+
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if attempts == 0 {
+		t.Fatalf("expected at least one attempt before cancellation")
+	}
+}
+
+func TestRetry_MaxElapsedTimeExpires(t *testing.T) {
+	attempts := 0
+
+	err := Retry(context.Background(), RetryPolicy{
+		InitialInterval: 5 * time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+		MaxElapsedTime:  20 * time.Millisecond,
+	}, func() error {
+		attempts++
+		return fakeRetryableErr{retryable: true}
+	})
+
+	if err == nil {
+		t.Fatalf("expected an error once MaxElapsedTime elapsed")
+	}
+	if attempts < 2 {
+		t.Fatalf("expected more than one attempt before giving up, got %d", attempts)
+	}
+}